@@ -1,7 +1,9 @@
 package om
 
 import (
+	"bytes"
 	"context"
+	"encoding/gob"
 	"encoding/json"
 	"fmt"
 	"reflect"
@@ -12,17 +14,70 @@ import (
 	"github.com/rueian/rueidis"
 )
 
+// Codec marshals and unmarshals the value of fields tagged `redis:",blob"` as an opaque
+// []byte. BuildIndex skips blob fields when deriving a RediSearch schema.
+type Codec interface {
+	Marshal(v interface{}) ([]byte, error)
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the Codec used by NewJSONRepository unless overridden with WithCodec. It is
+// just encoding/json.
+type JSONCodec struct{}
+
+// Marshal implements Codec using json.Marshal.
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+// Unmarshal implements Codec using json.Unmarshal.
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// GobCodec is a Codec backed by encoding/gob, useful for blob fields holding types that do not
+// round-trip through JSON, such as time.Time or big.Int.
+type GobCodec struct{}
+
+// Marshal implements Codec using encoding/gob.
+func (GobCodec) Marshal(v interface{}) ([]byte, error) {
+	buf := bytes.Buffer{}
+	err := gob.NewEncoder(&buf).Encode(v)
+	return buf.Bytes(), err
+}
+
+// Unmarshal implements Codec using encoding/gob.
+func (GobCodec) Unmarshal(data []byte, v interface{}) error {
+	return gob.NewDecoder(bytes.NewReader(data)).Decode(v)
+}
+
+// RepositoryOption configures a repository constructed by NewJSONRepository. NewHashRepository
+// takes no options, so a HashRepository has no Codec.
+type RepositoryOption func(*repositoryOptions)
+
+type repositoryOptions struct {
+	codec Codec
+}
+
+// WithCodec overrides the Codec used to marshal/unmarshal fields tagged `redis:",blob"`. The
+// default is JSONCodec.
+func WithCodec(codec Codec) RepositoryOption {
+	return func(o *repositoryOptions) { o.codec = codec }
+}
+
 // NewJSONRepository creates an JSONRepository.
 // The prefix parameter is used as redis key prefix. The entity stored by the repository will be named in the form of `{prefix}:{id}`
 // The schema parameter should be a struct with fields tagged with `redis:",key"` and `redis:",ver"`
-func NewJSONRepository(prefix string, schema interface{}, client rueidis.Client) Repository {
+func NewJSONRepository(prefix string, schema interface{}, client rueidis.Client, opts ...RepositoryOption) Repository {
+	o := repositoryOptions{codec: JSONCodec{}}
+	for _, opt := range opts {
+		opt(&o)
+	}
 	repo := &JSONRepository{
 		prefix: prefix,
 		idx:    "jsonidx:" + prefix,
 		typ:    reflect.TypeOf(schema),
 		client: client,
+		codec:  o.codec,
 	}
 	repo.schema = newSchema(repo.typ)
+	repo.blobs = blobFields(repo.typ)
 	return repo
 }
 
@@ -33,10 +88,33 @@ type JSONRepository struct {
 	schema schema
 	typ    reflect.Type
 	client rueidis.Client
+	codec  Codec
+	blobs  []blobField
 	prefix string
 	idx    string
 }
 
+// blobField is a struct field tagged `redis:",blob"`, whose value is run through the
+// repository's Codec before the JSON document is assembled, and back after it is decoded.
+type blobField struct {
+	idx  int
+	name string
+}
+
+// blobFields finds the blob fields of t, see blobField.
+func blobFields(t reflect.Type) []blobField {
+	var fields []blobField
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		for _, opt := range strings.Split(sf.Tag.Get("redis"), ",")[1:] {
+			if opt == "blob" {
+				fields = append(fields, blobField{idx: i, name: jsonFieldName(sf)})
+			}
+		}
+	}
+	return fields
+}
+
 // NewEntity returns an empty entity which type is `*{schema}` and will have the `redis:",key"` field be set with ULID automatically.
 func (r *JSONRepository) NewEntity() (entity interface{}) {
 	v := reflect.New(r.typ)
@@ -64,12 +142,155 @@ func (r *JSONRepository) FetchCache(ctx context.Context, id string, ttl time.Dur
 	return iface, err
 }
 
+// FetchMany fetches multiple entities with a single JSON.MGET and returns them as []*{schema},
+// in the same order as ids. A missing id decodes to a nil element instead of an error.
+func (r *JSONRepository) FetchMany(ctx context.Context, ids []string) (interface{}, error) {
+	keys := make([]string, len(ids))
+	for i, id := range ids {
+		keys[i] = key(r.prefix, id)
+	}
+	// Path "." (rather than the JSONPath "$") returns each reply as the bare document, the
+	// same shape Fetch and Search hand to decode; "$" would wrap every reply in a JSON array.
+	resp, err := r.client.Do(ctx, r.client.B().JsonMget().Key(keys...).Path(".").Build()).ToArray()
+	if err != nil {
+		return nil, err
+	}
+	s := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(r.typ)), len(resp), len(resp))
+	for i, rm := range resp {
+		if rm.IsNil() {
+			continue
+		}
+		record, err := rm.ToString()
+		if err != nil {
+			return nil, err
+		}
+		_, v, err := r.decode(record)
+		if err != nil {
+			return nil, err
+		}
+		s.Index(i).Set(v)
+	}
+	return s.Interface(), nil
+}
+
+// SaveMany pipelines Save for every entity in a single DoMulti round trip, still enforcing the
+// `,ver` optimistic lock. Each command sends jsonSaveScriptSrc via a raw EVAL rather than the
+// cached EVALSHA that jsonSaveScript.Exec uses, so the batch can't come back NOSCRIPT. It
+// returns one error per entity, in the same order as entities, nil for a successful save.
+func (r *JSONRepository) SaveMany(ctx context.Context, entities []interface{}) []error {
+	vals := make([]reflect.Value, len(entities))
+	cmds := make([]rueidis.Completed, len(entities))
+	errs := make([]error, len(entities))
+	for i, entity := range entities {
+		val, ok := ptrValueOf(entity, r.typ)
+		if !ok {
+			panic(fmt.Sprintf("input entity should be a pointer to %v", r.typ))
+		}
+		vals[i] = val
+
+		doc, err := r.encode(entity)
+		if err != nil {
+			errs[i] = err
+			cmds[i] = r.client.B().Ping().Build()
+			continue
+		}
+		cmds[i] = r.client.B().Eval().Script(jsonSaveScriptSrc).Numkeys(1).
+			Key(key(r.prefix, val.Field(r.schema.key.idx).String())).
+			Arg(jsonSaveArgs(r.schema.ver.name, val.Field(r.schema.ver.idx).Int(), doc)...).
+			Build()
+	}
+	for i, resp := range r.client.DoMulti(ctx, cmds...) {
+		if errs[i] != nil {
+			continue
+		}
+		str, err := resp.ToString()
+		if rueidis.IsRedisNil(err) {
+			errs[i] = ErrVersionMismatch
+			continue
+		}
+		if err != nil {
+			errs[i] = err
+			continue
+		}
+		ver, _ := strconv.ParseInt(str, 10, 64)
+		vals[i].Field(r.schema.ver.idx).SetInt(ver)
+	}
+	return errs
+}
+
+// encode marshals entity to its JSON document form, running any `redis:",blob"` fields
+// through r.codec first and storing the result as a []byte, which encoding/json base64-encodes.
+func (r *JSONRepository) encode(entity interface{}) (string, error) {
+	if len(r.blobs) == 0 {
+		sb := strings.Builder{}
+		err := json.NewEncoder(&sb).Encode(entity)
+		return sb.String(), err
+	}
+	raw, err := json.Marshal(entity)
+	if err != nil {
+		return "", err
+	}
+	doc := map[string]json.RawMessage{}
+	if err := json.Unmarshal(raw, &doc); err != nil {
+		return "", err
+	}
+	val := reflect.ValueOf(entity).Elem()
+	for _, b := range r.blobs {
+		bs, err := r.codec.Marshal(val.Field(b.idx).Interface())
+		if err != nil {
+			return "", err
+		}
+		enc, err := json.Marshal(bs)
+		if err != nil {
+			return "", err
+		}
+		doc[b.name] = enc
+	}
+	out, err := json.Marshal(doc)
+	return string(out), err
+}
+
 func (r *JSONRepository) decode(record string) (interface{}, reflect.Value, error) {
 	val := reflect.New(r.typ)
 	iface := val.Interface()
-	if err := json.NewDecoder(strings.NewReader(record)).Decode(iface); err != nil {
+	if len(r.blobs) == 0 {
+		if err := json.NewDecoder(strings.NewReader(record)).Decode(iface); err != nil {
+			return nil, reflect.Value{}, err
+		}
+		return iface, val, nil
+	}
+
+	doc := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(record), &doc); err != nil {
 		return nil, reflect.Value{}, err
 	}
+	blobs := make(map[int]json.RawMessage, len(r.blobs))
+	for _, b := range r.blobs {
+		if raw, ok := doc[b.name]; ok {
+			blobs[b.idx] = raw
+			delete(doc, b.name)
+		}
+	}
+	rest, err := json.Marshal(doc)
+	if err != nil {
+		return nil, reflect.Value{}, err
+	}
+	if err := json.Unmarshal(rest, iface); err != nil {
+		return nil, reflect.Value{}, err
+	}
+
+	elem := val.Elem()
+	for idx, raw := range blobs {
+		var bs []byte
+		if err := json.Unmarshal(raw, &bs); err != nil {
+			return nil, reflect.Value{}, err
+		}
+		fv := reflect.New(elem.Field(idx).Type())
+		if err := r.codec.Unmarshal(bs, fv.Interface()); err != nil {
+			return nil, reflect.Value{}, err
+		}
+		elem.Field(idx).Set(fv.Elem())
+	}
 	return iface, val, nil
 }
 
@@ -84,13 +305,13 @@ func (r *JSONRepository) Save(ctx context.Context, entity interface{}) (err erro
 	keyField := val.Field(r.schema.key.idx)
 	verField := val.Field(r.schema.ver.idx)
 
-	sb := strings.Builder{}
-	if err = json.NewEncoder(&sb).Encode(entity); err != nil {
+	doc, err := r.encode(entity)
+	if err != nil {
 		return err
 	}
 
 	str, err := jsonSaveScript.Exec(ctx, r.client, []string{key(r.prefix, keyField.String())}, []string{
-		r.schema.ver.name, strconv.FormatInt(verField.Int(), 10), sb.String(),
+		r.schema.ver.name, strconv.FormatInt(verField.Int(), 10), doc,
 	}).ToString()
 	if rueidis.IsRedisNil(err) {
 		return ErrVersionMismatch
@@ -108,6 +329,182 @@ func (r *JSONRepository) Remove(ctx context.Context, id string) error {
 	return r.client.Do(ctx, r.client.B().Del().Key(key(r.prefix, id)).Build()).Error()
 }
 
+// SaveWithTTL is like Save, but also arms a TTL on the entity's key as part of the same
+// atomic script.
+func (r *JSONRepository) SaveWithTTL(ctx context.Context, entity interface{}, ttl time.Duration) (err error) {
+	val, ok := ptrValueOf(entity, r.typ)
+	if !ok {
+		panic(fmt.Sprintf("input entity should be a pointer to %v", r.typ))
+	}
+
+	keyField := val.Field(r.schema.key.idx)
+	verField := val.Field(r.schema.ver.idx)
+
+	doc, err := r.encode(entity)
+	if err != nil {
+		return err
+	}
+
+	str, err := jsonSaveTTLScript.Exec(ctx, r.client, []string{key(r.prefix, keyField.String())}, []string{
+		r.schema.ver.name, strconv.FormatInt(verField.Int(), 10), doc, strconv.FormatInt(ttl.Milliseconds(), 10),
+	}).ToString()
+	if rueidis.IsRedisNil(err) {
+		return ErrVersionMismatch
+	}
+	if err != nil {
+		return err
+	}
+	ver, _ := strconv.ParseInt(str, 10, 64)
+	verField.SetInt(ver)
+	return nil
+}
+
+// Touch refreshes the TTL of the entity stored at `{prefix}:{id}` to ttl from now, without
+// touching its content or version.
+func (r *JSONRepository) Touch(ctx context.Context, id string, ttl time.Duration) error {
+	return r.client.Do(ctx, r.client.B().Pexpire().Key(key(r.prefix, id)).Milliseconds(ttl.Milliseconds()).Build()).Error()
+}
+
+// ExpireAt sets the entity stored at `{prefix}:{id}` to expire at t, without touching its
+// content or version.
+func (r *JSONRepository) ExpireAt(ctx context.Context, id string, t time.Time) error {
+	return r.client.Do(ctx, r.client.B().Pexpireat().Key(key(r.prefix, id)).MillisecondsTimestamp(t.UnixMilli()).Build()).Error()
+}
+
+// ftFieldSchema captures how a single entity field maps onto a RediSearch SCHEMA clause, as
+// derived from its `redis:"..."` struct tag by BuildIndex.
+type ftFieldSchema struct {
+	path      string
+	alias     string
+	kind      string
+	weight    float64
+	sortable  bool
+	separator string
+}
+
+// isFtSchemaOption reports whether opt looks like one of the recognised modifier tokens
+// (sortable, weight=, separator=), as opposed to a continuation of a preceding option's value.
+func isFtSchemaOption(opt string) bool {
+	return opt == "sortable" || strings.HasPrefix(opt, "weight=") || strings.HasPrefix(opt, "separator=")
+}
+
+// mergeFtSchemaOptions rejoins the modifier tokens of a `redis:"..."` tag that a blind
+// strings.Split(tag, ",") cut apart, for options such as separator= whose value may itself
+// contain a comma, e.g. the canonical `redis:"tags,tag,separator=,"` tag.
+func mergeFtSchemaOptions(opts []string) []string {
+	merged := make([]string, 0, len(opts))
+	for i := 0; i < len(opts); i++ {
+		opt := opts[i]
+		for strings.HasPrefix(opt, "separator=") && i+1 < len(opts) && !isFtSchemaOption(opts[i+1]) {
+			i++
+			opt += "," + opts[i]
+		}
+		merged = append(merged, opt)
+	}
+	return merged
+}
+
+// parseFtFieldSchema walks every field of t, exported or not, and extracts the RediSearch field
+// definitions carried by their `redis:"..."` tags, skipping the `key`, `ver` and `blob`
+// fields that NewJSONRepository and the Codec already manage themselves.
+func parseFtFieldSchema(t reflect.Type) ([]ftFieldSchema, error) {
+	var fields []ftFieldSchema
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		tag := sf.Tag.Get("redis")
+		if tag == "" {
+			continue
+		}
+		segs := strings.Split(tag, ",")
+		name, raw := segs[0], segs[1:]
+		if len(raw) == 0 || raw[0] == "key" || raw[0] == "ver" || raw[0] == "blob" {
+			continue
+		}
+		if name == "" {
+			name = jsonFieldName(sf)
+		}
+		f := ftFieldSchema{alias: name, kind: raw[0]}
+		f.path = "$." + f.alias
+		for _, opt := range mergeFtSchemaOptions(raw[1:]) {
+			switch {
+			case opt == "sortable":
+				f.sortable = true
+			case strings.HasPrefix(opt, "weight="):
+				f.weight, _ = strconv.ParseFloat(strings.TrimPrefix(opt, "weight="), 64)
+			case strings.HasPrefix(opt, "separator="):
+				f.separator = strings.TrimPrefix(opt, "separator=")
+			}
+		}
+		switch f.kind {
+		case "text", "tag", "numeric", "geo":
+		default:
+			return nil, fmt.Errorf("om: unsupported redis index type %q on field %s", f.kind, sf.Name)
+		}
+		fields = append(fields, f)
+	}
+	return fields, nil
+}
+
+// jsonFieldName returns the JSON path segment a struct field is encoded under, honouring its
+// `json:"..."` tag when present and falling back to the Go field name otherwise.
+func jsonFieldName(sf reflect.StructField) string {
+	if j := sf.Tag.Get("json"); j != "" {
+		if name := strings.Split(j, ",")[0]; name != "" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+// ftSchemaCall invokes the named method on v by reflection, used by BuildIndex to fold a
+// variable number of ftFieldSchema entries into the generated FT.CREATE SCHEMA builder chain.
+func ftSchemaCall(v reflect.Value, name string, args ...interface{}) reflect.Value {
+	in := make([]reflect.Value, len(args))
+	for i, a := range args {
+		in[i] = reflect.ValueOf(a)
+	}
+	return v.MethodByName(name).Call(in)[0]
+}
+
+// BuildIndex derives the FT.CREATE SCHEMA clause from struct tags such as
+// `redis:"name,text,weight=2,sortable"`, `redis:"tags,tag,separator=,"`,
+// `redis:"pop,numeric,sortable"` and `redis:"loc,geo"`, then creates the index the same way
+// CreateIndex does. It returns an error if any field's type token is not text, tag, numeric
+// or geo.
+func (r *JSONRepository) BuildIndex(ctx context.Context) error {
+	fields, err := parseFtFieldSchema(r.typ)
+	if err != nil {
+		return err
+	}
+	return r.CreateIndex(ctx, func(schema FtCreateSchema) Completed {
+		cur := reflect.ValueOf(schema)
+		for _, f := range fields {
+			cur = ftSchemaCall(cur, "FieldName", f.path)
+			cur = ftSchemaCall(cur, "As", f.alias)
+			switch f.kind {
+			case "text":
+				cur = ftSchemaCall(cur, "Text")
+				if f.weight != 0 {
+					cur = ftSchemaCall(cur, "Weight", f.weight)
+				}
+			case "tag":
+				cur = ftSchemaCall(cur, "Tag")
+				if f.separator != "" {
+					cur = ftSchemaCall(cur, "Separator", f.separator)
+				}
+			case "numeric":
+				cur = ftSchemaCall(cur, "Numeric")
+			case "geo":
+				cur = ftSchemaCall(cur, "Geo")
+			}
+			if f.sortable {
+				cur = ftSchemaCall(cur, "Sortable")
+			}
+		}
+		return ftSchemaCall(cur, "Build").Interface().(Completed)
+	})
+}
+
 // CreateIndex uses FT.CREATE from the RediSearch module to create inverted index under the name `jsonidx:{prefix}`
 // You can use the cmdFn parameter to mutate the index construction command,
 // and note that the field name should be specified with JSON path syntax, otherwise the index may not work as expected.
@@ -131,7 +528,70 @@ func (r *JSONRepository) Search(ctx context.Context, cmdFn func(search FtSearchI
 	if err != nil {
 		return 0, nil, err
 	}
+	return r.decodeSearch(resp)
+}
+
+// hasNoContent reports whether the built FT.SEARCH command includes NOCONTENT, which would
+// make decode's per-row "$" document lookup always miss.
+func hasNoContent(cmd interface{ Commands() []string }) bool {
+	for _, arg := range cmd.Commands() {
+		if strings.EqualFold(arg, "NOCONTENT") {
+			return true
+		}
+	}
+	return false
+}
+
+// SearchCache is like Search, but it issues the FT.SEARCH through DoCache. The cmdFn parameter
+// must end the command with Cache() instead of Build(), the same way it is done in FetchCache.
+// It returns an error if cmdFn sets NOCONTENT, since decode needs the full document.
+func (r *JSONRepository) SearchCache(ctx context.Context, ttl time.Duration, cmdFn func(search FtSearchIndex) rueidis.Cacheable) (int64, interface{}, error) {
+	cmd := cmdFn(r.client.B().FtSearch().Index(r.idx))
+	if hasNoContent(cmd) {
+		return 0, nil, fmt.Errorf("om: SearchCache requires the document body in the reply, NOCONTENT is not supported")
+	}
+	resp, err := r.client.DoCache(ctx, cmd, ttl).ToArray()
+	if err != nil {
+		return 0, nil, err
+	}
+	return r.decodeSearch(resp)
+}
 
+// SearchIter pages through the full result set of a query using LIMIT offset/pageSize,
+// invoking fn with each page of decoded entities. cmdFn is given the current offset and must
+// apply it with Limit(offset, pageSize). Iteration stops at the first error returned by fn or
+// by the search itself, or once every match has been visited. It returns an error if cmdFn
+// sets NOCONTENT, since decode needs the full document.
+func (r *JSONRepository) SearchIter(ctx context.Context, pageSize int64, cmdFn func(search FtSearchIndex, offset, pageSize int64) Completed, fn func(entities interface{}) error) error {
+	for offset := int64(0); ; {
+		cmd := cmdFn(r.client.B().FtSearch().Index(r.idx), offset, pageSize)
+		if hasNoContent(cmd) {
+			return fmt.Errorf("om: SearchIter requires the document body in the reply, NOCONTENT is not supported")
+		}
+		resp, err := r.client.Do(ctx, cmd).ToArray()
+		if err != nil {
+			return err
+		}
+		n, page, err := r.decodeSearch(resp)
+		if err != nil {
+			return err
+		}
+		got := int64(reflect.ValueOf(page).Len())
+		if got == 0 {
+			return nil
+		}
+		if err := fn(page); err != nil {
+			return err
+		}
+		offset += got
+		if offset >= n {
+			return nil
+		}
+	}
+}
+
+// decodeSearch decodes the reply of FT.SEARCH shared by Search and SearchCache.
+func (r *JSONRepository) decodeSearch(resp []rueidis.RedisMessage) (int64, interface{}, error) {
 	n, _ := resp[0].ToInt64()
 	s := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(r.typ)), 0, len(resp[1:])/2)
 	for i := 2; i < len(resp); i += 2 {
@@ -149,11 +609,97 @@ func (r *JSONRepository) Search(ctx context.Context, cmdFn func(search FtSearchI
 	return n, s.Interface(), nil
 }
 
-var jsonSaveScript = rueidis.NewLuaScript(`
+// AggregateResult holds the decoded response of an FT.AGGREGATE query issued through Aggregate
+// or AggregateCursorRead.
+type AggregateResult struct {
+	// Total is the number of rows present in this response.
+	Total int64
+	// Cursor is non-zero when the query was built WITHCURSOR and more rows remain to be read
+	// with AggregateCursorRead; callers are done once it comes back zero.
+	Cursor int64
+	// Rows holds one map of field name to value per aggregated row.
+	Rows []map[string]rueidis.RedisMessage
+}
+
+// Aggregate uses FT.AGGREGATE from the RediSearch module to run GROUPBY/REDUCE style queries
+// against the index whose name is `jsonidx:{prefix}`. You can use the cmdFn parameter to build
+// the aggregation pipeline, including WITHCURSOR to page through AggregateCursorRead.
+func (r *JSONRepository) Aggregate(ctx context.Context, cmdFn func(a FtAggregateIndex) Completed) (*AggregateResult, error) {
+	resp, err := r.client.Do(ctx, cmdFn(r.client.B().FtAggregate().Index(r.idx))).ToArray()
+	if err != nil {
+		return nil, err
+	}
+	return decodeAggregate(resp)
+}
+
+// AggregateCursorRead continues reading from the cursor id returned by a prior Aggregate or
+// AggregateCursorRead call made against the same index with WITHCURSOR.
+func (r *JSONRepository) AggregateCursorRead(ctx context.Context, cursor int64, count int64) (*AggregateResult, error) {
+	resp, err := r.client.Do(ctx, r.client.B().FtCursor().Read().Index(r.idx).Cursor(cursor).Count(count).Build()).ToArray()
+	if err != nil {
+		return nil, err
+	}
+	return decodeAggregate(resp)
+}
+
+// AggregateCursorDel deletes a cursor opened by Aggregate or AggregateCursorRead before it
+// would otherwise expire on its own.
+func (r *JSONRepository) AggregateCursorDel(ctx context.Context, cursor int64) error {
+	return r.client.Do(ctx, r.client.B().FtCursor().Del().Index(r.idx).Cursor(cursor).Build()).Error()
+}
+
+// decodeAggregate decodes the reply of FT.AGGREGATE and FT.CURSOR READ, which is either a
+// plain array of rows, or a two-element [rows, cursor id] array when WITHCURSOR was used.
+func decodeAggregate(resp []rueidis.RedisMessage) (*AggregateResult, error) {
+	res := &AggregateResult{}
+	rows := resp
+	if len(resp) == 2 {
+		if cursor, err := resp[1].ToInt64(); err == nil {
+			if first, err := resp[0].ToArray(); err == nil {
+				rows, res.Cursor = first, cursor
+			}
+		}
+	}
+	res.Total = int64(len(rows))
+	res.Rows = make([]map[string]rueidis.RedisMessage, 0, len(rows))
+	for _, row := range rows {
+		kv, _ := row.ToArray()
+		m := make(map[string]rueidis.RedisMessage, len(kv)/2)
+		for i := 0; i+1 < len(kv); i += 2 {
+			k, _ := kv[i].ToString()
+			m[k] = kv[i+1]
+		}
+		res.Rows = append(res.Rows, m)
+	}
+	return res, nil
+}
+
+const jsonSaveScriptSrc = `
+local v = redis.call('JSON.GET',KEYS[1],ARGV[1])
+if (not v or v == ARGV[2])
+then
+  redis.call('JSON.SET',KEYS[1],'$',ARGV[3])
+  return redis.call('JSON.NUMINCRBY',KEYS[1],ARGV[1],1)
+end
+return nil
+`
+
+var jsonSaveScript = rueidis.NewLuaScript(jsonSaveScriptSrc)
+
+// jsonSaveArgs builds the ARGV for jsonSaveScriptSrc: the `,ver` field name, its current value,
+// and the encoded document.
+func jsonSaveArgs(verName string, ver int64, doc string) []string {
+	return []string{verName, strconv.FormatInt(ver, 10), doc}
+}
+
+// jsonSaveTTLScript is jsonSaveScript plus a PEXPIRE of the key, applied atomically alongside
+// the same `,ver` optimistic-lock check, for SaveWithTTL.
+var jsonSaveTTLScript = rueidis.NewLuaScript(`
 local v = redis.call('JSON.GET',KEYS[1],ARGV[1])
 if (not v or v == ARGV[2])
 then
   redis.call('JSON.SET',KEYS[1],'$',ARGV[3])
+  redis.call('PEXPIRE',KEYS[1],ARGV[4])
   return redis.call('JSON.NUMINCRBY',KEYS[1],ARGV[1],1)
 end
 return nil
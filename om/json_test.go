@@ -0,0 +1,171 @@
+package om
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/rueian/rueidis"
+	"github.com/rueian/rueidis/mock"
+)
+
+func TestJSONCodecRoundTrip(t *testing.T) {
+	type payload struct {
+		A int
+		B string
+	}
+	in := payload{A: 1, B: "hello"}
+
+	bs, err := (JSONCodec{}).Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var out payload
+	if err := (JSONCodec{}).Unmarshal(bs, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if out != in {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+}
+
+func TestGobCodecRoundTrip(t *testing.T) {
+	in := map[string]int{"a": 1, "b": 2, "c": 3}
+
+	bs, err := (GobCodec{}).Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var out map[string]int
+	if err := (GobCodec{}).Unmarshal(bs, &out); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+	if !reflect.DeepEqual(out, in) {
+		t.Fatalf("got %+v, want %+v", out, in)
+	}
+}
+
+type blobSchema struct {
+	Key  string         `redis:",key"`
+	Ver  int64          `redis:",ver"`
+	Name string         `redis:"name,text"`
+	Data map[string]int `redis:"data,blob"`
+}
+
+// TestBlobFieldEncodeDecode exercises JSONRepository.encode/decode for a codec whose output
+// is not valid UTF-8, the exact corruption GobCodec hit when blob bytes were round-tripped as
+// a plain string instead of a []byte.
+func TestBlobFieldEncodeDecode(t *testing.T) {
+	typ := reflect.TypeOf(blobSchema{})
+	r := &JSONRepository{
+		typ:    typ,
+		codec:  GobCodec{},
+		blobs:  blobFields(typ),
+		schema: newSchema(typ),
+	}
+
+	in := &blobSchema{Key: "id1", Name: "alice", Data: map[string]int{"x": 1, "y": 2}}
+	doc, err := r.encode(in)
+	if err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+
+	iface, _, err := r.decode(doc)
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	out := iface.(*blobSchema)
+	if out.Name != in.Name {
+		t.Fatalf("Name: got %q, want %q", out.Name, in.Name)
+	}
+	if !reflect.DeepEqual(out.Data, in.Data) {
+		t.Fatalf("Data: got %+v, want %+v", out.Data, in.Data)
+	}
+}
+
+func TestParseFtFieldSchema(t *testing.T) {
+	fields, err := parseFtFieldSchema(reflect.TypeOf(blobSchema{}))
+	if err != nil {
+		t.Fatalf("parseFtFieldSchema: %v", err)
+	}
+	if len(fields) != 1 || fields[0].alias != "name" || fields[0].kind != "text" {
+		t.Fatalf("expected only the text field, got %+v", fields)
+	}
+}
+
+func TestParseFtFieldSchemaSeparatorWithComma(t *testing.T) {
+	type schema struct {
+		Key  string `redis:",key"`
+		Ver  int64  `redis:",ver"`
+		Tags string `redis:"tags,tag,separator=,"`
+	}
+	fields, err := parseFtFieldSchema(reflect.TypeOf(schema{}))
+	if err != nil {
+		t.Fatalf("parseFtFieldSchema: %v", err)
+	}
+	if len(fields) != 1 || fields[0].separator != "," {
+		t.Fatalf("expected separator \",\", got %+v", fields)
+	}
+}
+
+func TestJSONSaveArgs(t *testing.T) {
+	args := jsonSaveArgs("ver", 3, `{"name":"alice"}`)
+	want := []string{"ver", "3", `{"name":"alice"}`}
+	if !reflect.DeepEqual(args, want) {
+		t.Fatalf("got %+v, want %+v", args, want)
+	}
+}
+
+func TestParseFtFieldSchemaUnsupportedType(t *testing.T) {
+	type schema struct {
+		Key   string `redis:",key"`
+		Ver   int64  `redis:",ver"`
+		Bogus string `redis:"bogus,vector"`
+	}
+	if _, err := parseFtFieldSchema(reflect.TypeOf(schema{})); err == nil {
+		t.Fatal("expected an error for an unsupported index type")
+	}
+}
+
+type fakeCmd struct{ commands []string }
+
+func (c fakeCmd) Commands() []string { return c.commands }
+
+func TestHasNoContent(t *testing.T) {
+	if hasNoContent(fakeCmd{[]string{"FT.SEARCH", "jsonidx:x", "*"}}) {
+		t.Fatal("expected false without NOCONTENT")
+	}
+	if !hasNoContent(fakeCmd{[]string{"FT.SEARCH", "jsonidx:x", "*", "nocontent"}}) {
+		t.Fatal("expected true for a case-insensitive NOCONTENT match")
+	}
+}
+
+func TestDecodeAggregateRows(t *testing.T) {
+	resp := []rueidis.RedisMessage{
+		mock.RedisArray(mock.RedisString("name"), mock.RedisString("alice")),
+		mock.RedisArray(mock.RedisString("name"), mock.RedisString("bob")),
+	}
+	res, err := decodeAggregate(resp)
+	if err != nil {
+		t.Fatalf("decodeAggregate: %v", err)
+	}
+	if res.Total != 2 || res.Cursor != 0 || len(res.Rows) != 2 {
+		t.Fatalf("got %+v", res)
+	}
+	if name, _ := res.Rows[1]["name"].ToString(); name != "bob" {
+		t.Fatalf("got %q, want bob", name)
+	}
+}
+
+func TestDecodeAggregateCursor(t *testing.T) {
+	resp := []rueidis.RedisMessage{
+		mock.RedisArray(mock.RedisArray(mock.RedisString("name"), mock.RedisString("alice"))),
+		mock.RedisInt64(7),
+	}
+	res, err := decodeAggregate(resp)
+	if err != nil {
+		t.Fatalf("decodeAggregate: %v", err)
+	}
+	if res.Cursor != 7 || res.Total != 1 {
+		t.Fatalf("got %+v", res)
+	}
+}